@@ -0,0 +1,194 @@
+package aws
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/ec2rolecreds"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// defaultMetadataTokenTTL is the TTL requested for IMDSv2 session tokens.
+const defaultMetadataTokenTTL = 6 * 60 * 60
+
+// Config holds the provider-level settings used to resolve AWS credentials
+// and build clients for the various AWS services.
+type Config struct {
+	AccessKey string
+	SecretKey string
+	Token     string
+	Region    string
+
+	AssumeRoleARN         string
+	AssumeRoleSessionName string
+	AssumeRoleExternalID  string
+	AssumeRolePolicy      string
+
+	// MetadataAPIMode controls how the EC2 instance metadata service is
+	// queried for IAM role credentials: "v1" only ever issues the legacy
+	// unauthenticated requests, "v2" requires a session token and fails
+	// if one can't be obtained, and "auto" (the default) tries v2 first
+	// and falls back to v1 on 403/404.
+	MetadataAPIMode string
+
+	// Profile and SharedCredentialsFile select a named profile out of a
+	// shared credentials INI file (defaults to ~/.aws/credentials when
+	// SharedCredentialsFile is empty), consulted after env vars and
+	// before the EC2 instance role.
+	Profile               string
+	SharedCredentialsFile string
+}
+
+// getCreds builds the chain of credential providers used to resolve AWS
+// credentials, in precedence order: static keys, environment variables, the
+// shared credentials profile, and finally the EC2 instance role.
+// metadataAPIMode selects how the instance metadata service is queried for
+// the role credentials; an empty string defaults to "auto".
+func getCreds(key, secret, token, profile, sharedCredentialsFile, metadataAPIMode string) *credentials.Credentials {
+	if metadataAPIMode == "" {
+		metadataAPIMode = "auto"
+	}
+
+	// Build the list of providers to look for creds in
+	providers := []credentials.Provider{
+		&credentials.StaticProvider{Value: credentials.Value{
+			AccessKeyID:     key,
+			SecretAccessKey: secret,
+			SessionToken:    token,
+		}},
+		&credentials.EnvProvider{},
+		&credentials.SharedCredentialsProvider{
+			Filename: sharedCredentialsFile,
+			Profile:  profile,
+		},
+		&ec2rolecreds.EC2RoleProvider{
+			Client: ec2metadata.New(session.New(&aws.Config{
+				Endpoint:   aws.String(os.Getenv("AWS_METADATA_URL")),
+				HTTPClient: &http.Client{Transport: newMetadataTransport(metadataAPIMode)},
+			})),
+		},
+	}
+
+	return credentials.NewChainCredentials(providers)
+}
+
+// metadataTransport is an http.RoundTripper that negotiates IMDSv2 by
+// fetching a session token via PUT /latest/api/token and attaching it as
+// X-aws-ec2-metadata-token on subsequent metadata requests. In "auto" mode
+// it silently falls back to unauthenticated (IMDSv1) requests if the token
+// request can't be sent or the token endpoint returns 403/404, and any other
+// status is an error; in "v2" mode a failed token fetch is fatal; in
+// "v1" mode the token dance is skipped entirely.
+type metadataTransport struct {
+	mode  string
+	base  http.RoundTripper
+	token string
+}
+
+func newMetadataTransport(mode string) *metadataTransport {
+	return &metadataTransport{mode: mode, base: http.DefaultTransport}
+}
+
+func (t *metadataTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.mode == "v1" {
+		return t.base.RoundTrip(req)
+	}
+
+	if t.token == "" {
+		tokenURL := *req.URL
+		tokenURL.Path = "/latest/api/token"
+		tokenReq, err := http.NewRequest("PUT", tokenURL.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		tokenReq.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", strconv.Itoa(defaultMetadataTokenTTL))
+
+		resp, err := t.base.RoundTrip(tokenReq)
+		if err != nil {
+			if t.mode == "v2" {
+				return nil, err
+			}
+		} else {
+			status := resp.StatusCode
+			var body []byte
+			if status == http.StatusOK {
+				body, err = ioutil.ReadAll(resp.Body)
+			}
+			resp.Body.Close()
+
+			if status == http.StatusOK && err == nil {
+				t.token = string(body)
+			} else if t.mode == "v2" || (status != http.StatusForbidden && status != http.StatusNotFound) {
+				return nil, fmt.Errorf("could not obtain IMDSv2 token, status %d", status)
+			}
+		}
+	}
+
+	if t.token != "" {
+		req.Header.Set("X-aws-ec2-metadata-token", t.token)
+	}
+
+	return t.base.RoundTrip(req)
+}
+
+// assumeRoleCreds wraps the base credential chain in an STS
+// AssumeRoleProvider when an assume_role block has been configured, so that
+// all downstream AWS API calls use the resulting temporary credentials.
+func (c *Config) assumeRoleCreds(baseCreds *credentials.Credentials) (*credentials.Credentials, error) {
+	if c.AssumeRoleARN == "" {
+		return baseCreds, nil
+	}
+
+	awsConfig := &aws.Config{
+		Credentials: baseCreds,
+		Region:      aws.String(c.Region),
+	}
+	if endpoint := os.Getenv("AWS_STS_ENDPOINT"); endpoint != "" {
+		awsConfig.Endpoint = aws.String(endpoint)
+	}
+	sess := session.New(awsConfig)
+
+	return stscreds.NewCredentials(sess, c.AssumeRoleARN, func(p *stscreds.AssumeRoleProvider) {
+		if c.AssumeRoleSessionName != "" {
+			p.RoleSessionName = c.AssumeRoleSessionName
+		}
+		if c.AssumeRoleExternalID != "" {
+			p.ExternalID = aws.String(c.AssumeRoleExternalID)
+		}
+		if c.AssumeRolePolicy != "" {
+			p.Policy = aws.String(c.AssumeRolePolicy)
+		}
+	}), nil
+}
+
+// policyDocsEqual normalizes two IAM-style JSON policy documents by
+// unmarshaling them into map[string]interface{} and comparing the resulting
+// structures, so that key reordering or whitespace differences introduced by
+// AWS don't produce spurious diffs (the same approach used for
+// AssumeRolePolicyDocument elsewhere in this provider).
+//
+// TODO: this stripped-down checkout doesn't carry the schema.Resource for
+// the AWS provider's assume_role block, so there is nowhere yet to attach a
+// DiffSuppressFunc backed by this. Wire it into the `policy` field's
+// schema.Schema once that resource file is present in this tree.
+func policyDocsEqual(a, b string) (bool, error) {
+	var aMap, bMap map[string]interface{}
+
+	if err := json.Unmarshal([]byte(a), &aMap); err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal([]byte(b), &bMap); err != nil {
+		return false, err
+	}
+
+	return reflect.DeepEqual(aMap, bMap), nil
+}
@@ -3,9 +3,11 @@ package aws
 import (
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/aws/aws-sdk-go/aws/awserr"
@@ -16,13 +18,14 @@ import (
 var k = os.Getenv("AWS_ACCESS_KEY_ID")
 var s = os.Getenv("AWS_SECRET_ACCESS_KEY")
 var to = os.Getenv("AWS_SESSION_TOKEN")
+var sharedCredsFileEnv, sharedCredsFileEnvSet = os.LookupEnv("AWS_SHARED_CREDENTIALS_FILE")
 
 func TestAWSConfig_shouldError(t *testing.T) {
 	unsetEnv(t)
 	defer resetEnv(t)
 	cfg := Config{}
 
-	c := getCreds(cfg.AccessKey, cfg.SecretKey, cfg.Token)
+	c := getCreds(cfg.AccessKey, cfg.SecretKey, cfg.Token, cfg.Profile, cfg.SharedCredentialsFile, cfg.MetadataAPIMode)
 	_, err := c.Get()
 	if awsErr, ok := err.(awserr.Error); ok {
 		if awsErr.Code() != "NoCredentialProviders" {
@@ -55,7 +58,7 @@ func TestAWSConfig_shouldBeStatic(t *testing.T) {
 			Token:     c.Token,
 		}
 
-		creds := getCreds(cfg.AccessKey, cfg.SecretKey, cfg.Token)
+		creds := getCreds(cfg.AccessKey, cfg.SecretKey, cfg.Token, cfg.Profile, cfg.SharedCredentialsFile, cfg.MetadataAPIMode)
 		if creds == nil {
 			t.Fatalf("Expected a static creds provider to be returned")
 		}
@@ -90,7 +93,7 @@ func TestAWSConfig_shouldIAM(t *testing.T) {
 	// An empty config, no key supplied
 	cfg := Config{}
 
-	creds := getCreds(cfg.AccessKey, cfg.SecretKey, cfg.Token)
+	creds := getCreds(cfg.AccessKey, cfg.SecretKey, cfg.Token, cfg.Profile, cfg.SharedCredentialsFile, cfg.MetadataAPIMode)
 	if creds == nil {
 		t.Fatalf("Expected a static creds provider to be returned")
 	}
@@ -139,7 +142,7 @@ func TestAWSConfig_shouldIgnoreIAM(t *testing.T) {
 			Token:     c.Token,
 		}
 
-		creds := getCreds(cfg.AccessKey, cfg.SecretKey, cfg.Token)
+		creds := getCreds(cfg.AccessKey, cfg.SecretKey, cfg.Token, cfg.Profile, cfg.SharedCredentialsFile, cfg.MetadataAPIMode)
 		if creds == nil {
 			t.Fatalf("Expected a static creds provider to be returned")
 		}
@@ -167,7 +170,7 @@ func TestAWSConfig_shouldBeENV(t *testing.T) {
 	defer resetEnv(t)
 
 	cfg := Config{}
-	creds := getCreds(cfg.AccessKey, cfg.SecretKey, cfg.Token)
+	creds := getCreds(cfg.AccessKey, cfg.SecretKey, cfg.Token, cfg.Profile, cfg.SharedCredentialsFile, cfg.MetadataAPIMode)
 	if creds == nil {
 		t.Fatalf("Expected a static creds provider to be returned")
 	}
@@ -186,6 +189,318 @@ func TestAWSConfig_shouldBeENV(t *testing.T) {
 	}
 }
 
+func TestAWSConfig_shouldBeSharedCredentialsProfile(t *testing.T) {
+	unsetEnv(t)
+	defer resetEnv(t)
+
+	file := writeSharedCredentialsFile(t, `
+[default]
+aws_access_key_id = defaultkey
+aws_secret_access_key = defaultsecret
+
+[nondefault]
+aws_access_key_id = nondefaultkey
+aws_secret_access_key = nondefaultsecret
+aws_session_token = nondefaulttoken
+`)
+	defer os.Remove(file)
+
+	cases := []struct {
+		Profile            string
+		Key, Secret, Token string
+	}{
+		{Profile: "", Key: "defaultkey", Secret: "defaultsecret"},
+		{Profile: "nondefault", Key: "nondefaultkey", Secret: "nondefaultsecret", Token: "nondefaulttoken"},
+	}
+
+	for _, c := range cases {
+		cfg := Config{Profile: c.Profile, SharedCredentialsFile: file}
+
+		creds := getCreds(cfg.AccessKey, cfg.SecretKey, cfg.Token, cfg.Profile, cfg.SharedCredentialsFile, cfg.MetadataAPIMode)
+		v, err := creds.Get()
+		if err != nil {
+			t.Fatalf("Error gettings creds for profile %q: %s", c.Profile, err)
+		}
+		if v.AccessKeyID != c.Key {
+			t.Fatalf("AccessKeyID mismatch, expected: (%s), got (%s)", c.Key, v.AccessKeyID)
+		}
+		if v.SecretAccessKey != c.Secret {
+			t.Fatalf("SecretAccessKey mismatch, expected: (%s), got (%s)", c.Secret, v.SecretAccessKey)
+		}
+		if v.SessionToken != c.Token {
+			t.Fatalf("SessionToken mismatch, expected: (%s), got (%s)", c.Token, v.SessionToken)
+		}
+	}
+}
+
+func TestAWSConfig_sharedCredentialsProfileMissing(t *testing.T) {
+	unsetEnv(t)
+	defer resetEnv(t)
+
+	file := writeSharedCredentialsFile(t, `
+[default]
+aws_access_key_id = defaultkey
+aws_secret_access_key = defaultsecret
+`)
+	defer os.Remove(file)
+
+	cfg := Config{Profile: "doesnotexist", SharedCredentialsFile: file}
+
+	creds := getCreds(cfg.AccessKey, cfg.SecretKey, cfg.Token, cfg.Profile, cfg.SharedCredentialsFile, cfg.MetadataAPIMode)
+	_, err := creds.Get()
+	if err == nil {
+		t.Fatalf("Expected an error for a missing shared credentials profile")
+	}
+	if awsErr, ok := err.(awserr.Error); ok {
+		if awsErr.Code() != "NoCredentialProviders" {
+			t.Fatalf("Expected NoCredentialProviders error, got: %s", awsErr.Code())
+		}
+	}
+}
+
+// writeSharedCredentialsFile writes contents to a temp file formatted as an
+// AWS shared credentials INI file and returns its path.
+func writeSharedCredentialsFile(t *testing.T, contents string) string {
+	f, err := ioutil.TempFile("", "aws-shared-credentials")
+	if err != nil {
+		t.Fatalf("Error creating temp shared credentials file: %s", err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(contents); err != nil {
+		t.Fatalf("Error writing temp shared credentials file: %s", err)
+	}
+
+	return f.Name()
+}
+
+// TestAWSConfig_shouldIAMAutoV2 verifies that in "auto" mode, getCreds
+// negotiates an IMDSv2 token before fetching role credentials.
+func TestAWSConfig_shouldIAMAutoV2(t *testing.T) {
+	unsetEnv(t)
+	defer resetEnv(t)
+
+	ts := awsEnvV2Only(t)
+	defer ts()
+
+	cfg := Config{MetadataAPIMode: "auto"}
+
+	creds := getCreds(cfg.AccessKey, cfg.SecretKey, cfg.Token, cfg.Profile, cfg.SharedCredentialsFile, cfg.MetadataAPIMode)
+	v, err := creds.Get()
+	if err != nil {
+		t.Fatalf("Error gettings creds: %s", err)
+	}
+	if v.AccessKeyID != "somekey" {
+		t.Fatalf("AccessKeyID mismatch, expected: (somekey), got (%s)", v.AccessKeyID)
+	}
+}
+
+// TestAWSConfig_shouldIAMV1Fallback verifies that in "auto" mode, getCreds
+// falls back to unauthenticated IMDSv1 requests when the instance has no
+// token endpoint (legacy behavior).
+func TestAWSConfig_shouldIAMV1Fallback(t *testing.T) {
+	unsetEnv(t)
+	defer resetEnv(t)
+
+	// awsEnv doesn't serve /latest/api/token, so the "auto" transport's
+	// token request 404s and it must fall back to v1 GETs.
+	ts := awsEnv(t)
+	defer ts()
+
+	cfg := Config{MetadataAPIMode: "auto"}
+
+	creds := getCreds(cfg.AccessKey, cfg.SecretKey, cfg.Token, cfg.Profile, cfg.SharedCredentialsFile, cfg.MetadataAPIMode)
+	v, err := creds.Get()
+	if err != nil {
+		t.Fatalf("Error gettings creds: %s", err)
+	}
+	if v.AccessKeyID != "somekey" {
+		t.Fatalf("AccessKeyID mismatch, expected: (somekey), got (%s)", v.AccessKeyID)
+	}
+}
+
+// TestAWSConfig_shouldIAMV1OnlyRejected verifies that a v2-only instance
+// rejects the untokened GETs issued when metadata_api_mode is forced to
+// "v1".
+func TestAWSConfig_shouldIAMV1OnlyRejected(t *testing.T) {
+	unsetEnv(t)
+	defer resetEnv(t)
+
+	ts := awsEnvV2Only(t)
+	defer ts()
+
+	cfg := Config{MetadataAPIMode: "v1"}
+
+	creds := getCreds(cfg.AccessKey, cfg.SecretKey, cfg.Token, cfg.Profile, cfg.SharedCredentialsFile, cfg.MetadataAPIMode)
+	_, err := creds.Get()
+	if err == nil {
+		t.Fatalf("Expected an error fetching creds without a v2 token from a v2-only instance")
+	}
+}
+
+// TestAWSConfig_shouldIAMV2NoTokenEndpoint verifies that forcing
+// metadata_api_mode to "v2" against an instance with no token endpoint (the
+// awsEnv fixture doesn't serve /latest/api/token) fails outright instead of
+// silently falling back to IMDSv1.
+func TestAWSConfig_shouldIAMV2NoTokenEndpoint(t *testing.T) {
+	unsetEnv(t)
+	defer resetEnv(t)
+
+	ts := awsEnv(t)
+	defer ts()
+
+	cfg := Config{MetadataAPIMode: "v2"}
+
+	creds := getCreds(cfg.AccessKey, cfg.SecretKey, cfg.Token, cfg.Profile, cfg.SharedCredentialsFile, cfg.MetadataAPIMode)
+	_, err := creds.Get()
+	if err == nil {
+		t.Fatalf("Expected an error in v2 mode when no token endpoint is available")
+	}
+}
+
+func TestAWSConfig_assumeRole(t *testing.T) {
+	ts := stsEnv(t, "somekey", "somesecret", "sometoken", "")
+	defer ts()
+
+	cfg := Config{
+		AccessKey:             "test",
+		SecretKey:             "test",
+		AssumeRoleARN:         "arn:aws:iam::123456789012:role/testrole",
+		AssumeRoleSessionName: "terraform-test",
+		AssumeRoleExternalID:  "test-external-id",
+	}
+
+	base := getCreds(cfg.AccessKey, cfg.SecretKey, cfg.Token, cfg.Profile, cfg.SharedCredentialsFile, cfg.MetadataAPIMode)
+	creds, err := cfg.assumeRoleCreds(base)
+	if err != nil {
+		t.Fatalf("Error building assume role credentials: %s", err)
+	}
+
+	v, err := creds.Get()
+	if err != nil {
+		t.Fatalf("Error getting assumed role creds: %s", err)
+	}
+	if v.AccessKeyID != "somekey" {
+		t.Fatalf("AccessKeyID mismatch, expected: (somekey), got (%s)", v.AccessKeyID)
+	}
+	if v.SecretAccessKey != "somesecret" {
+		t.Fatalf("SecretAccessKey mismatch, expected: (somesecret), got (%s)", v.SecretAccessKey)
+	}
+	if v.SessionToken != "sometoken" {
+		t.Fatalf("SessionToken mismatch, expected: (sometoken), got (%s)", v.SessionToken)
+	}
+}
+
+func TestAWSConfig_assumeRoleInvalidRole(t *testing.T) {
+	ts := stsEnv(t, "", "", "", "AccessDenied")
+	defer ts()
+
+	cfg := Config{
+		AccessKey:     "test",
+		SecretKey:     "test",
+		AssumeRoleARN: "arn:aws:iam::123456789012:role/doesnotexist",
+	}
+
+	base := getCreds(cfg.AccessKey, cfg.SecretKey, cfg.Token, cfg.Profile, cfg.SharedCredentialsFile, cfg.MetadataAPIMode)
+	creds, err := cfg.assumeRoleCreds(base)
+	if err != nil {
+		t.Fatalf("Error building assume role credentials: %s", err)
+	}
+
+	_, err = creds.Get()
+	if err == nil {
+		t.Fatalf("Expected an error assuming an invalid role")
+	}
+	if awsErr, ok := err.(awserr.Error); ok {
+		if awsErr.Code() != "AccessDenied" {
+			t.Fatalf("Expected AccessDenied error, got: %s", awsErr.Code())
+		}
+	} else {
+		t.Fatalf("Expected an awserr.Error, got: %s", err)
+	}
+}
+
+func TestAWSConfig_assumeRoleMissingBaseCreds(t *testing.T) {
+	unsetEnv(t)
+	defer resetEnv(t)
+
+	cfg := Config{
+		AssumeRoleARN: "arn:aws:iam::123456789012:role/testrole",
+	}
+
+	base := getCreds(cfg.AccessKey, cfg.SecretKey, cfg.Token, cfg.Profile, cfg.SharedCredentialsFile, cfg.MetadataAPIMode)
+	creds, err := cfg.assumeRoleCreds(base)
+	if err != nil {
+		t.Fatalf("Error building assume role credentials: %s", err)
+	}
+
+	_, err = creds.Get()
+	if err == nil {
+		t.Fatalf("Expected an error assuming a role without base credentials")
+	}
+	if awsErr, ok := err.(awserr.Error); ok {
+		if awsErr.Code() != "NoCredentialProviders" {
+			t.Fatalf("Expected NoCredentialProviders error, got: %s", awsErr.Code())
+		}
+	}
+}
+
+func TestPolicyDocsEqual(t *testing.T) {
+	cases := []struct {
+		A, B  string
+		Equal bool
+	}{
+		{
+			A:     `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"*","Resource":"*"}]}`,
+			B:     `{"Statement": [{"Resource": "*", "Action": "*", "Effect": "Allow"}], "Version": "2012-10-17"}`,
+			Equal: true,
+		},
+		{
+			A:     `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"*","Resource":"*"}]}`,
+			B:     `{"Version":"2012-10-17","Statement":[{"Effect":"Deny","Action":"*","Resource":"*"}]}`,
+			Equal: false,
+		},
+	}
+
+	for i, c := range cases {
+		equal, err := policyDocsEqual(c.A, c.B)
+		if err != nil {
+			t.Fatalf("case %d: unexpected error: %s", i, err)
+		}
+		if equal != c.Equal {
+			t.Fatalf("case %d: expected equal=%t, got %t", i, c.Equal, equal)
+		}
+	}
+}
+
+// stsEnv establishes a httptest server that mocks out the STS AssumeRole
+// endpoint, returning either a successful AssumeRole response carrying the
+// given credentials, or an error response with the given AWS error code.
+func stsEnv(t *testing.T, accessKey, secretKey, token, errCode string) func() {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if errCode != "" {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprintf(w, `<?xml version="1.0"?>
+<ErrorResponse><Error><Code>%s</Code><Message>mock error</Message></Error></ErrorResponse>`, errCode)
+			return
+		}
+
+		fmt.Fprintf(w, `<?xml version="1.0"?>
+<AssumeRoleResponse><AssumeRoleResult><Credentials>
+<AccessKeyId>%s</AccessKeyId>
+<SecretAccessKey>%s</SecretAccessKey>
+<SessionToken>%s</SessionToken>
+<Expiration>2099-01-01T00:00:00Z</Expiration>
+</Credentials></AssumeRoleResult></AssumeRoleResponse>`, accessKey, secretKey, token)
+	}))
+
+	os.Setenv("AWS_STS_ENDPOINT", ts.URL)
+	return func() {
+		os.Unsetenv("AWS_STS_ENDPOINT")
+		ts.Close()
+	}
+}
+
 // unsetEnv unsets enviornment variables for testing a "clean slate" with no
 // credentials in the environment
 func unsetEnv(t *testing.T) {
@@ -198,6 +513,13 @@ func unsetEnv(t *testing.T) {
 	if err := os.Unsetenv("AWS_SESSION_TOKEN"); err != nil {
 		t.Fatalf("Error unsetting env var AWS_SESSION_TOKEN: %s", err)
 	}
+
+	// Point the shared credentials provider's default lookup at a file
+	// that doesn't exist, so a developer's real ~/.aws/credentials can't
+	// leak into tests that expect to fall through to the EC2 role.
+	if err := os.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(os.TempDir(), "tf-aws-provider-test-no-shared-credentials")); err != nil {
+		t.Fatalf("Error setting env var AWS_SHARED_CREDENTIALS_FILE: %s", err)
+	}
 }
 
 func resetEnv(t *testing.T) {
@@ -211,6 +533,14 @@ func resetEnv(t *testing.T) {
 	if err := os.Setenv("AWS_SESSION_TOKEN", to); err != nil {
 		t.Fatalf("Error resetting env var AWS_SESSION_TOKEN: %s", err)
 	}
+
+	if sharedCredsFileEnvSet {
+		if err := os.Setenv("AWS_SHARED_CREDENTIALS_FILE", sharedCredsFileEnv); err != nil {
+			t.Fatalf("Error resetting env var AWS_SHARED_CREDENTIALS_FILE: %s", err)
+		}
+	} else if err := os.Unsetenv("AWS_SHARED_CREDENTIALS_FILE"); err != nil {
+		t.Fatalf("Error unsetting env var AWS_SHARED_CREDENTIALS_FILE: %s", err)
+	}
 }
 
 func setEnv(s string, t *testing.T) {
@@ -231,18 +561,61 @@ func setEnv(s string, t *testing.T) {
 // API calls to this internal URL. By replacing the server with a test server,
 // we can simulate an AWS environment
 func awsEnv(t *testing.T) func() {
+	return awsEnvMode(t, aws_routes, false)
+}
+
+// awsEnvV2Only behaves like awsEnv, but serves the IMDSv2 token endpoint and
+// rejects any metadata GET that doesn't carry a valid
+// X-aws-ec2-metadata-token header, simulating an instance with IMDSv1
+// disabled.
+func awsEnvV2Only(t *testing.T) func() {
+	return awsEnvMode(t, aws_routes, true)
+}
+
+// awsEnvMode establishes a httptest server to mock out the internal AWS
+// Metadata service. requireToken simulates an instance with IMDSv1 disabled:
+// it serves the IMDSv2 PUT /latest/api/token handshake and rejects metadata
+// GETs without a valid token. Without requireToken the token endpoint is not
+// served and 404s, as on a legacy IMDSv1-only instance.
+func awsEnvMode(t *testing.T, routesJSON string, requireToken bool) func() {
 	routes := routes{}
-	if err := json.Unmarshal([]byte(aws_routes), &routes); err != nil {
+	if err := json.Unmarshal([]byte(routesJSON), &routes); err != nil {
 		t.Fatalf("Failed to unmarshal JSON in AWS ENV test: %s", err)
 	}
+
+	var issuedToken string
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/plain")
 		w.Header().Add("Server", "MockEC2")
+
+		if requireToken && r.URL.Path == "/latest/api/token" && r.Method == "PUT" {
+			ttl := r.Header.Get("X-aws-ec2-metadata-token-ttl-seconds")
+			if ttl == "" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			issuedToken = "mock-imdsv2-token"
+			w.Header().Set("X-aws-ec2-metadata-token-ttl-seconds", ttl)
+			fmt.Fprint(w, issuedToken)
+			return
+		}
+
+		if requireToken && (issuedToken == "" || r.Header.Get("X-aws-ec2-metadata-token") != issuedToken) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
 		for _, e := range routes.Endpoints {
-			if r.RequestURI == e.Uri {
+			method := e.Method
+			if method == "" {
+				method = "GET"
+			}
+			if r.RequestURI == e.Uri && r.Method == method {
 				fmt.Fprintln(w, e.Body)
+				return
 			}
 		}
+		w.WriteHeader(http.StatusNotFound)
 	}))
 
 	os.Setenv("AWS_METADATA_URL", ts.URL)
@@ -253,8 +626,9 @@ type routes struct {
 	Endpoints []*endpoint `json:"endpoints"`
 }
 type endpoint struct {
-	Uri  string `json:"uri"`
-	Body string `json:"body"`
+	Uri    string `json:"uri"`
+	Method string `json:"method"`
+	Body   string `json:"body"`
 }
 
 const aws_routes = `
@@ -262,10 +636,12 @@ const aws_routes = `
   "endpoints": [
     {
       "uri": "/meta-data/iam/security-credentials",
+      "method": "GET",
       "body": "test_role"
     },
     {
       "uri": "/meta-data/iam/security-credentials/test_role",
+      "method": "GET",
       "body": "{\"Code\":\"Success\",\"LastUpdated\":\"2015-12-11T17:17:25Z\",\"Type\":\"AWS-HMAC\",\"AccessKeyId\":\"somekey\",\"SecretAccessKey\":\"somesecret\",\"Token\":\"sometoken\"}"
     }
   ]
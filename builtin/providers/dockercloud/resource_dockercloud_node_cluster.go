@@ -10,6 +10,60 @@ import (
 	"github.com/hashicorp/terraform/helper/schema"
 )
 
+// Defaults for the timeouts/poll_interval/not_found_checks schema fields,
+// matching the values the create/update/delete paths previously hardcoded.
+const (
+	defaultOperationTimeout = "60m"
+	defaultPollInterval     = "3s"
+	defaultNotFoundChecks   = 60
+)
+
+// operationTimeout resolves the configured timeout for the given operation
+// ("create", "update", or "delete") out of the resource's `timeouts` block,
+// falling back to defaultOperationTimeout if it's unset or unparseable.
+func operationTimeout(d *schema.ResourceData, op string) time.Duration {
+	def, _ := time.ParseDuration(defaultOperationTimeout)
+
+	attr, ok := d.GetOk("timeouts")
+	if !ok {
+		return def
+	}
+	set := attr.(*schema.Set)
+	if set.Len() == 0 {
+		return def
+	}
+
+	raw, ok := set.List()[0].(map[string]interface{})[op].(string)
+	if !ok || raw == "" {
+		return def
+	}
+
+	parsed, err := time.ParseDuration(raw)
+	if err != nil {
+		return def
+	}
+
+	return parsed
+}
+
+// pollInterval resolves the configured `poll_interval`, falling back to
+// defaultPollInterval if it's unset or unparseable.
+func pollInterval(d *schema.ResourceData) time.Duration {
+	def, _ := time.ParseDuration(defaultPollInterval)
+
+	raw, ok := d.Get("poll_interval").(string)
+	if !ok || raw == "" {
+		return def
+	}
+
+	parsed, err := time.ParseDuration(raw)
+	if err != nil {
+		return def
+	}
+
+	return parsed
+}
+
 func resourceDockercloudNodeCluster() *schema.Resource {
 	return &schema.Resource{
 		Create: resourceDockercloudNodeClusterCreate,
@@ -55,6 +109,50 @@ func resourceDockercloudNodeCluster() *schema.Resource {
 				Type:     schema.TypeString,
 				Computed: true,
 			},
+			"max_panic_retries": &schema.Schema{
+				Type:     schema.TypeInt,
+				Optional: true,
+				Default:  defaultMaxPanicRetries,
+			},
+			"poll_interval": &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+				Default:  defaultPollInterval,
+			},
+			"not_found_checks": &schema.Schema{
+				Type:     schema.TypeInt,
+				Optional: true,
+				Default:  defaultNotFoundChecks,
+			},
+			"timeouts": &schema.Schema{
+				Type:     schema.TypeSet,
+				Optional: true,
+				MaxItems: 1,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"create": &schema.Schema{
+							Type:     schema.TypeString,
+							Optional: true,
+							Default:  defaultOperationTimeout,
+						},
+						"update": &schema.Schema{
+							Type:     schema.TypeString,
+							Optional: true,
+							Default:  defaultOperationTimeout,
+						},
+						"delete": &schema.Schema{
+							Type:     schema.TypeString,
+							Optional: true,
+							Default:  defaultOperationTimeout,
+						},
+						"read": &schema.Schema{
+							Type:     schema.TypeString,
+							Optional: true,
+							Default:  defaultOperationTimeout,
+						},
+					},
+				},
+			},
 			"tags": &schema.Schema{
 				Type:     schema.TypeList,
 				Optional: true,
@@ -169,11 +267,11 @@ func resourceDockercloudNodeClusterCreate(d *schema.ResourceData, meta interface
 	stateConf := &resource.StateChangeConf{
 		Pending:        []string{"Deploying"},
 		Target:         []string{"Deployed"},
-		Refresh:        newNodeClusterStateRefreshFunc(d, meta),
-		Timeout:        60 * time.Minute,
+		Refresh:        withPanicRecovery(newNodeClusterStateRefreshFunc(d, meta), d.Get("max_panic_retries").(int)),
+		Timeout:        operationTimeout(d, "create"),
 		Delay:          10 * time.Second,
-		MinTimeout:     3 * time.Second,
-		NotFoundChecks: 60,
+		MinTimeout:     pollInterval(d),
+		NotFoundChecks: d.Get("not_found_checks").(int),
 	}
 
 	nodeClusterRaw, err := stateConf.WaitForState()
@@ -241,11 +339,11 @@ func resourceDockercloudNodeClusterUpdate(d *schema.ResourceData, meta interface
 	stateConf := &resource.StateChangeConf{
 		Pending:        []string{"Scaling"},
 		Target:         []string{"Deployed"},
-		Refresh:        newNodeClusterStateRefreshFunc(d, meta),
-		Timeout:        60 * time.Minute,
+		Refresh:        withPanicRecovery(newNodeClusterStateRefreshFunc(d, meta), d.Get("max_panic_retries").(int)),
+		Timeout:        operationTimeout(d, "update"),
 		Delay:          10 * time.Second,
-		MinTimeout:     3 * time.Second,
-		NotFoundChecks: 60,
+		MinTimeout:     pollInterval(d),
+		NotFoundChecks: d.Get("not_found_checks").(int),
 	}
 
 	_, err = stateConf.WaitForState()
@@ -274,11 +372,11 @@ func resourceDockercloudNodeClusterDelete(d *schema.ResourceData, meta interface
 	stateConf := &resource.StateChangeConf{
 		Pending:        []string{"Terminating", "Empty cluster"},
 		Target:         []string{"Terminated"},
-		Refresh:        newNodeClusterStateRefreshFunc(d, meta),
-		Timeout:        60 * time.Minute,
+		Refresh:        withPanicRecovery(newNodeClusterStateRefreshFunc(d, meta), d.Get("max_panic_retries").(int)),
+		Timeout:        operationTimeout(d, "delete"),
 		Delay:          10 * time.Second,
-		MinTimeout:     3 * time.Second,
-		NotFoundChecks: 60,
+		MinTimeout:     pollInterval(d),
+		NotFoundChecks: d.Get("not_found_checks").(int),
 	}
 
 	_, err = stateConf.WaitForState()
@@ -0,0 +1,268 @@
+package dockercloud
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/docker/go-dockercloud/dockercloud"
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/helper/schema"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func resourceDockercloudStack() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceDockercloudStackCreate,
+		Read:   resourceDockercloudStackRead,
+		Update: resourceDockercloudStackUpdate,
+		Delete: resourceDockercloudStackDelete,
+		Exists: resourceDockercloudStackExists,
+
+		Schema: map[string]*schema.Schema{
+			"name": &schema.Schema{
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"services": &schema.Schema{
+				Type:          schema.TypeMap,
+				Optional:      true,
+				ConflictsWith: []string{"compose_file"},
+				Elem:          &schema.Schema{Type: schema.TypeString},
+			},
+			"compose_file": &schema.Schema{
+				Type:          schema.TypeString,
+				Optional:      true,
+				ConflictsWith: []string{"services"},
+			},
+			"redeploy_on_change": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			"state": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"max_panic_retries": &schema.Schema{
+				Type:     schema.TypeInt,
+				Optional: true,
+				Default:  defaultMaxPanicRetries,
+			},
+		},
+	}
+}
+
+func resourceDockercloudStackCreate(d *schema.ResourceData, meta interface{}) error {
+	opts, err := stackCreateRequestFromResourceData(d)
+	if err != nil {
+		return err
+	}
+
+	stack, err := dockercloud.CreateStack(*opts)
+	if err != nil {
+		return fmt.Errorf("Error creating stack: %s", err)
+	}
+
+	if err = stack.Start(); err != nil {
+		return fmt.Errorf("Error starting stack: %s", err)
+	}
+
+	d.SetId(stack.Uuid)
+	d.Set("state", stack.State)
+
+	stateConf := &resource.StateChangeConf{
+		Pending:        []string{"Starting"},
+		Target:         []string{"Running"},
+		Refresh:        withPanicRecovery(newStackStateRefreshFunc(d, meta), d.Get("max_panic_retries").(int)),
+		Timeout:        60 * time.Minute,
+		Delay:          10 * time.Second,
+		MinTimeout:     3 * time.Second,
+		NotFoundChecks: 60,
+	}
+
+	stackRaw, err := stateConf.WaitForState()
+	if err != nil {
+		return fmt.Errorf("Error waiting for stack (%s) to become ready: %s", d.Id(), err)
+	}
+
+	stack = stackRaw.(dockercloud.Stack)
+	d.Set("state", stack.State)
+
+	return resourceDockercloudStackRead(d, meta)
+}
+
+func resourceDockercloudStackRead(d *schema.ResourceData, meta interface{}) error {
+	stack, err := dockercloud.GetStack(d.Id())
+	if err != nil {
+		if strings.Contains(err.Error(), "404 NOT FOUND") {
+			d.SetId("")
+			return nil
+		}
+
+		return fmt.Errorf("Error retrieving stack: %s", err)
+	}
+
+	if stack.State == "Terminated" {
+		d.SetId("")
+		return nil
+	}
+
+	d.Set("name", stack.Name)
+	d.Set("state", stack.State)
+
+	return nil
+}
+
+func resourceDockercloudStackUpdate(d *schema.ResourceData, meta interface{}) error {
+	if !d.Get("redeploy_on_change").(bool) {
+		return nil
+	}
+	if !d.HasChange("services") && !d.HasChange("compose_file") {
+		return nil
+	}
+
+	opts, err := stackCreateRequestFromResourceData(d)
+	if err != nil {
+		return err
+	}
+
+	stack, err := dockercloud.GetStack(d.Id())
+	if err != nil {
+		return fmt.Errorf("Error retrieving stack (%s): %s", d.Id(), err)
+	}
+
+	if err := stack.Update(*opts); err != nil {
+		return fmt.Errorf("Error updating stack: %s", err)
+	}
+
+	if err := stack.Redeploy(); err != nil {
+		return fmt.Errorf("Error redeploying stack: %s", err)
+	}
+
+	stateConf := &resource.StateChangeConf{
+		Pending:        []string{"Starting"},
+		Target:         []string{"Running"},
+		Refresh:        withPanicRecovery(newStackStateRefreshFunc(d, meta), d.Get("max_panic_retries").(int)),
+		Timeout:        60 * time.Minute,
+		Delay:          10 * time.Second,
+		MinTimeout:     3 * time.Second,
+		NotFoundChecks: 60,
+	}
+
+	_, err = stateConf.WaitForState()
+	if err != nil {
+		return fmt.Errorf("Error waiting for stack (%s) to redeploy: %s", d.Id(), err)
+	}
+
+	return nil
+}
+
+func resourceDockercloudStackDelete(d *schema.ResourceData, meta interface{}) error {
+	stack, err := dockercloud.GetStack(d.Id())
+	if err != nil {
+		return fmt.Errorf("Error retrieving stack (%s): %s", d.Id(), err)
+	}
+
+	if stack.State == "Terminated" {
+		d.SetId("")
+		return nil
+	}
+
+	if err = stack.Delete(); err != nil {
+		return fmt.Errorf("Error deleting stack (%s): %s", d.Id(), err)
+	}
+
+	d.SetId("")
+
+	return nil
+}
+
+func resourceDockercloudStackExists(d *schema.ResourceData, meta interface{}) (bool, error) {
+	stack, err := dockercloud.GetStack(d.Id())
+	if err != nil {
+		return false, err
+	}
+
+	if stack.Uuid == d.Id() {
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func newStackStateRefreshFunc(d *schema.ResourceData, meta interface{}) resource.StateRefreshFunc {
+	return func() (interface{}, string, error) {
+		stack, err := dockercloud.GetStack(d.Id())
+		if err != nil {
+			return nil, "", err
+		}
+
+		return stack, stack.State, nil
+	}
+}
+
+// stackCreateRequestFromResourceData converts the resource's `services`
+// map or `compose_file` path into a docker-compose document, then
+// translates that document into Docker Cloud's stack JSON.
+func stackCreateRequestFromResourceData(d *schema.ResourceData) (*dockercloud.StackCreateRequest, error) {
+	compose, err := composeDocumentFromResourceData(d)
+	if err != nil {
+		return nil, err
+	}
+
+	return stackFromCompose(d.Get("name").(string), compose)
+}
+
+func composeDocumentFromResourceData(d *schema.ResourceData) (map[string]interface{}, error) {
+	if v, ok := d.GetOk("compose_file"); ok {
+		data, err := ioutil.ReadFile(v.(string))
+		if err != nil {
+			return nil, fmt.Errorf("Error reading compose_file: %s", err)
+		}
+
+		doc := map[string]interface{}{}
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("Error parsing compose_file: %s", err)
+		}
+
+		return doc, nil
+	}
+
+	services := d.Get("services").(map[string]interface{})
+	doc := make(map[string]interface{}, len(services))
+	for name, raw := range services {
+		var svc interface{}
+		if err := yaml.Unmarshal([]byte(raw.(string)), &svc); err != nil {
+			return nil, fmt.Errorf("Error parsing service %q definition: %s", name, err)
+		}
+		doc[name] = svc
+	}
+
+	return doc, nil
+}
+
+// stackFromCompose translates the compose document into Docker Cloud's
+// stack request schema, one dockercloud.StackService per compose service,
+// each carrying only its own service definition marshaled back to YAML.
+func stackFromCompose(name string, compose map[string]interface{}) (*dockercloud.StackCreateRequest, error) {
+	services := make([]dockercloud.StackService, 0, len(compose))
+	for serviceName, serviceDef := range compose {
+		raw, err := yaml.Marshal(map[string]interface{}{serviceName: serviceDef})
+		if err != nil {
+			return nil, fmt.Errorf("Error marshaling service %q definition to YAML: %s", serviceName, err)
+		}
+
+		services = append(services, dockercloud.StackService{
+			Name:       serviceName,
+			Stack_file: string(raw),
+		})
+	}
+
+	return &dockercloud.StackCreateRequest{
+		Name:     name,
+		Services: services,
+	}, nil
+}
@@ -0,0 +1,63 @@
+package dockercloud
+
+import (
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/resource"
+)
+
+// defaultMaxPanicRetries is the number of times a panicking refresh func is
+// re-invoked, after a short backoff, before the panic is surfaced to
+// WaitForState as an error.
+const defaultMaxPanicRetries = 3
+
+// panicRetryBackoff is the delay between a recovered panic and the next
+// retry of the underlying refresh func. Variable (not const) so tests can
+// shrink it.
+var panicRetryBackoff = 2 * time.Second
+
+// withPanicRecovery decorates a resource.StateRefreshFunc so that a panic
+// from the dockercloud SDK - a transient nil deref on a partial API response
+// - doesn't crash the whole `terraform apply` run. The panic is recovered,
+// converted into an error carrying the stack trace, and the refresh is
+// retried up to maxRetries times (after a short backoff) before the error is
+// surfaced to WaitForState.
+func withPanicRecovery(refresh resource.StateRefreshFunc, maxRetries int) resource.StateRefreshFunc {
+	return func() (result interface{}, state string, err error) {
+		retries := 0
+
+		for {
+			result, state, err = safeRefresh(refresh)
+			if _, ok := err.(*panicError); !ok || retries >= maxRetries {
+				return result, state, err
+			}
+
+			retries++
+			time.Sleep(panicRetryBackoff)
+		}
+	}
+}
+
+// safeRefresh invokes refresh, recovering any panic into a *panicError.
+func safeRefresh(refresh resource.StateRefreshFunc) (result interface{}, state string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &panicError{recovered: r, stack: debug.Stack()}
+		}
+	}()
+
+	return refresh()
+}
+
+// panicError wraps a recovered panic from a dockercloud SDK call along with
+// the stack trace at the point of the panic.
+type panicError struct {
+	recovered interface{}
+	stack     []byte
+}
+
+func (e *panicError) Error() string {
+	return fmt.Sprintf("recovered from panic in dockercloud refresh: %v\n%s", e.recovered, e.stack)
+}
@@ -0,0 +1,55 @@
+package dockercloud
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWithPanicRecovery(t *testing.T) {
+	orig := panicRetryBackoff
+	panicRetryBackoff = time.Millisecond
+	defer func() { panicRetryBackoff = orig }()
+
+	cases := []struct {
+		name        string
+		panicsCount int
+		maxRetries  int
+		wantErr     bool
+	}{
+		{name: "immediate success", panicsCount: 0, maxRetries: 3, wantErr: false},
+		{name: "panic then success within retries", panicsCount: 2, maxRetries: 3, wantErr: false},
+		{name: "panics exceed max retries", panicsCount: 4, maxRetries: 3, wantErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			calls := 0
+			refresh := func() (interface{}, string, error) {
+				calls++
+				if calls <= c.panicsCount {
+					panic("simulated dockercloud SDK panic")
+				}
+				return "result", "Deployed", nil
+			}
+
+			result, state, err := withPanicRecovery(refresh, c.maxRetries)()
+
+			if c.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got none")
+				}
+				if _, ok := err.(*panicError); !ok {
+					t.Fatalf("expected a *panicError, got %T: %s", err, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if result != "result" || state != "Deployed" {
+				t.Fatalf("unexpected result: (%v, %s)", result, state)
+			}
+		})
+	}
+}